@@ -6,10 +6,15 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -20,44 +25,86 @@ var tmpDir = "tmp"
 // The directory where the files are stored that are already organized and therefore should be removed from this tmp folder
 var targetDir = "reference/api"
 
+// The Mintlify navigation config that new files get registered in
+var mintConfigPath = "mint.json"
+
+// The config listing which scraped endpoints should be kept in (or left out of) the published reference
+var docsgenConfigPath = "docsgen.json"
+
+// The manifest storing the sidebar name and target directory chosen for each route, so renaming
+// never has to be done twice
+var namesManifestPath = "names.json"
+
 // Files in the targetDir that should be ignored (not removed) even though they do not appear in the OpenAPI spec
 var ignoreFiles = map[string]bool{
 	fmt.Sprintf("%s/introduction.mdx", targetDir): true,
 }
 
+var dryRun = flag.Bool("dry-run", false, "print the new files instead of writing them into mint.json")
+var ciMode = flag.Bool("ci", false, "fail instead of prompting when a route's sidebar name is missing from names.json")
+
+// fileSystem is the subset of filesystem operations match, rename, and the deletion flow need:
+// reads via fs.FS (so fs.WalkDir and friends work against it) plus the handful of write
+// operations those functions use, which fs.FS itself doesn't expose.
+type fileSystem interface {
+	fs.FS
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath string, newpath string) error
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+// osFS is the fileSystem backed by the real filesystem, rooted at the process's working directory.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) { return os.Open(name) }
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+func (osFS) Remove(name string) error             { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error          { return os.RemoveAll(path) }
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
 func main() {
+	flag.Parse()
+	os.Exit(run(osFS{}))
+}
 
-	defer clean(tmpDir)
-	existingFiles, newFiles, err := match(tmpDir, targetDir)
+// run does the actual work and returns the process exit code. It is split out from main so that
+// defer clean(fsys, tmpDir) always fires before main calls os.Exit, which would otherwise skip it,
+// including on the non-zero exit for routes missing from the names manifest.
+func run(fsys fileSystem) int {
+	defer clean(fsys, tmpDir)
+
+	docsgenConfig, err := loadDocsgenConfig(docsgenConfigPath)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return 0
 	}
+	selectFunc := buildSelectFunc(docsgenConfig)
 
-	oldFiles, err := getAllFilesInDir(targetDir)
+	existingFiles, newFiles, err := match(fsys, tmpDir, targetDir, selectFunc)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return 0
 	}
 
-	var removeFiles []string
-	for _, oldFile := range oldFiles {
-		if ok, _ := ignoreFiles[oldFile]; ok {
-			continue
-		}
-
-		found := false
-		for _, existingFile := range existingFiles {
-			if oldFile == existingFile {
-				found = true
-				break
-			}
-		}
-		if !found {
-			removeFiles = append(removeFiles, oldFile)
-		}
+	oldFiles, err := getAllFilesInDir(fsys, targetDir)
+	if err != nil {
+		fmt.Println(err)
+		return 0
 	}
 
+	removeFiles := filesToRemove(oldFiles, existingFiles, ignoreFiles)
+
 	if len(removeFiles) > 0 {
 		fmt.Println("=====================================")
 		fmt.Println("The following files are no longer in the OpenAPI spec and will be removed:")
@@ -69,92 +116,395 @@ func main() {
 		answer, err := reader.ReadString('\n')
 		if err != nil {
 			fmt.Println(err)
-			return
+			return 0
 		}
 		answer = strings.TrimSpace(answer)
 		if answer != "y" {
 			fmt.Println("Aborted.")
-			return
+			return 0
 		}
 
 		for _, file := range removeFiles {
-			err := os.Remove(file)
+			err := fsys.Remove(file)
 			if err != nil {
 				fmt.Println(err)
-				return
+				return 0
 			}
 		}
 	}
 
 	if len(newFiles) == 0 {
 		fmt.Println("Done.")
-		return
+		return 0
+	}
+
+	namesManifest, err := loadNamesManifest(namesManifestPath)
+	if err != nil {
+		fmt.Println(err)
+		return 0
 	}
 
 	fmt.Println("=====================================")
 	fmt.Println("One or more new API endpoints were found!")
-	fmt.Println("Please state what these API endpoints should appear as in the API reference sidebar.")
-	fmt.Println("(Leave empty to accept the default suggestion)")
+	if !*ciMode {
+		fmt.Println("Please state what these API endpoints should appear as in the API reference sidebar.")
+		fmt.Println("(Leave empty to accept the default suggestion)")
+	}
 
-	renamedFiles, err := rename(tmpDir, targetDir, newFiles)
+	renamedFiles, manifestChanged, err := rename(fsys, tmpDir, targetDir, newFiles, namesManifest, *ciMode)
+	if manifestChanged {
+		if werr := writeNamesManifest(namesManifestPath, namesManifest); werr != nil {
+			fmt.Println(werr)
+			return 0
+		}
+	}
 	if err != nil {
 		fmt.Println(err)
-		return
+		var missingErr *missingRouteNamesError
+		if errors.As(err, &missingErr) {
+			return 1
+		}
+		return 0
 	}
 
-	fmt.Println("Now add the newly generated files to mint.json (create your own groups!):")
 	sort.Sort(sort.StringSlice(renamedFiles))
-	for _, file := range renamedFiles {
-		fmt.Printf("\"%s\",\n", strings.TrimSuffix(file, ".mdx"))
+	if *dryRun {
+		fmt.Println("Now add the newly generated files to mint.json (create your own groups!):")
+		for _, file := range renamedFiles {
+			fmt.Printf("\"%s\",\n", strings.TrimSuffix(file, ".mdx"))
+		}
+		return 0
+	}
+
+	if err := updateMintNavigation(mintConfigPath, targetDir, renamedFiles); err != nil {
+		fmt.Println(err)
+		return 0
+	}
+	fmt.Printf("Added %d new page(s) to %s.\n", len(renamedFiles), mintConfigPath)
+	return 0
+}
+
+// updateMintNavigation registers newFiles in the Mintlify navigation config, grouping
+// each one under the group matching its resource segment (e.g. reference/api/orders/*
+// files land in an "Orders" group), creating the group if it doesn't exist yet. Existing
+// groups are mutated in place rather than rebuilt, so fields Mintlify supports beyond
+// group/pages (icon, tag, hidden, ...) survive untouched, and a group's pages are only
+// re-sorted if a new file actually landed in it this run.
+func updateMintNavigation(mintConfigPath string, targetDir string, newFiles []string) error {
+	data, err := ioutil.ReadFile(mintConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", mintConfigPath, err)
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", mintConfigPath, err)
+	}
+
+	var navigation []interface{}
+	if navRaw, ok := config["navigation"].([]interface{}); ok {
+		navigation = navRaw
+	}
+
+	groupIndex := map[string]int{}
+	for i, g := range navigation {
+		if gm, ok := g.(map[string]interface{}); ok {
+			if name, ok := gm["group"].(string); ok {
+				groupIndex[name] = i
+			}
+		}
+	}
+
+	touched := map[string]bool{}
+	for _, file := range newFiles {
+		groupName := resourceGroupName(file, targetDir)
+
+		idx, ok := groupIndex[groupName]
+		if !ok {
+			navigation = append(navigation, map[string]interface{}{"group": groupName})
+			idx = len(navigation) - 1
+			groupIndex[groupName] = idx
+		}
+
+		gm := navigation[idx].(map[string]interface{})
+		gm["pages"] = append(groupPages(gm["pages"]), strings.TrimSuffix(file, ".mdx"))
+		touched[groupName] = true
+	}
+
+	for name := range touched {
+		gm := navigation[groupIndex[name]].(map[string]interface{})
+		pages := groupPages(gm["pages"])
+		sort.SliceStable(pages, func(i, j int) bool {
+			return pageSortKey(pages[i]) < pageSortKey(pages[j])
+		})
+		gm["pages"] = pages
+	}
+
+	config["navigation"] = navigation
+
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", mintConfigPath, err)
+	}
+	out = append(out, '\n')
+
+	return ioutil.WriteFile(mintConfigPath, out, 0644)
+}
+
+// groupPages normalizes a group's "pages" field into a []interface{}, leaving each entry (a
+// plain page string or a nested sub-group object) untouched so nothing is silently dropped.
+func groupPages(raw interface{}) []interface{} {
+	pages, _ := raw.([]interface{})
+	return pages
+}
+
+// pageSortKey returns the string a pages entry should be sorted by: the page path itself for
+// plain string entries, or the nested sub-group's name for sub-group objects.
+func pageSortKey(p interface{}) string {
+	switch v := p.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		name, _ := v["group"].(string)
+		return name
+	default:
+		return ""
+	}
+}
+
+// resourceGroupName derives the sidebar group a file belongs to from the resource
+// segment immediately under targetDir, e.g. "reference/api/orders/list.mdx" => "Orders".
+func resourceGroupName(file string, targetDir string) string {
+	rel := strings.TrimPrefix(file, targetDir+"/")
+	resource := strings.SplitN(rel, "/", 2)[0]
+	resource = strings.ReplaceAll(resource, "-", " ")
+	resource = strings.ReplaceAll(resource, "_", " ")
+	return strings.Title(resource)
+}
+
+// filesToRemove returns the oldFiles that are neither still accounted for by existingFiles nor
+// in the ignore list.
+func filesToRemove(oldFiles []string, existingFiles []string, ignore map[string]bool) []string {
+	existing := map[string]bool{}
+	for _, f := range existingFiles {
+		existing[f] = true
+	}
+
+	var remove []string
+	for _, oldFile := range oldFiles {
+		if ignore[oldFile] || existing[oldFile] {
+			continue
+		}
+		remove = append(remove, oldFile)
 	}
+	return remove
+}
+
+// scrapedFile is a file found in tmpDir that passed selectFunc and is a candidate to be matched
+// up against an existing target file.
+type scrapedFile struct {
+	path     string
+	routeKey string
+	content  []byte
 }
 
 // match traverses the `tmp` directory already exist in the `reference` directory and which ones are new.
-func match(tmpDir string, targetDir string) (existingFiles []string, newFiles []string, err error) {
-	err = filepath.Walk(tmpDir, func(path string, info os.FileInfo, err error) error {
+// Files that selectFunc rejects are deleted from tmp on the spot and never reach existingFiles or newFiles.
+//
+// A scraped file is considered existing if it matches a target file by route identity, or failing
+// that, by content similarity - in both cases the target file is overwritten in place rather than
+// deleted and recreated, so its filename and sidebar placement survive trivial spec changes. Every
+// scraped file is matched against every target at once (see assignMatches) so two unrelated scraped
+// files can never both be assigned the same target.
+func match(fsys fileSystem, tmpDir string, targetDir string, selectFunc SelectFunc) (existingFiles []string, newFiles []string, err error) {
+	targets, err := indexTargetFiles(fsys, targetDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var scraped []scrapedFile
+	err = fs.WalkDir(fsys, tmpDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := fsys.ReadFile(path)
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			content, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			matchingFile, err := findMatchingFile(targetDir, content)
-			if err != nil {
-				return err
-			}
 
-			if matchingFile != "" {
-				err := os.Remove(path)
-				if err != nil {
-					return err
-				}
-				existingFiles = append(existingFiles, matchingFile)
-			} else {
-				newFiles = append(newFiles, path)
-			}
+		method, route, tags, _ := parseFileHeader(content)
+		if !selectFunc(method, route, tags) {
+			return fsys.Remove(path)
 		}
+
+		var routeKey string
+		if method != "" {
+			routeKey = fmt.Sprintf("%s %s", method, route)
+		}
+		scraped = append(scraped, scrapedFile{path: path, routeKey: routeKey, content: content})
 		return nil
 	})
 	if err != nil {
 		return nil, nil, err
 	}
+
+	assignments := assignMatches(scraped, targets)
+	for _, s := range scraped {
+		matchingFile, matched := assignments[s.path]
+		if !matched {
+			newFiles = append(newFiles, s.path)
+			continue
+		}
+		if err := fsys.WriteFile(matchingFile, s.content, 0644); err != nil {
+			return nil, nil, err
+		}
+		if err := fsys.Remove(s.path); err != nil {
+			return nil, nil, err
+		}
+		existingFiles = append(existingFiles, matchingFile)
+	}
 	return existingFiles, newFiles, nil
 }
 
-func clean(tmpDir string) {
-	_ = os.RemoveAll(fmt.Sprintf("%s/", tmpDir))
+// SelectFunc decides whether a scraped endpoint should be kept in the published reference,
+// mirroring the SelectFunc pattern restic's archiver uses to filter files while walking a tree.
+type SelectFunc func(method string, route string, tags []string) bool
+
+// docsgenConfig lists the include/exclude rules teams use to keep private or beta endpoints
+// out of the published reference without editing the OpenAPI spec itself.
+type docsgenConfig struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// loadDocsgenConfig reads the docsgen config from path, returning a nil config (select everything)
+// if no such file exists.
+func loadDocsgenConfig(path string) (*docsgenConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg docsgenConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// buildSelectFunc turns a docsgenConfig into a SelectFunc. Exclude rules are checked first and
+// always win; when include rules are present, a route must match one of them to be kept.
+func buildSelectFunc(cfg *docsgenConfig) SelectFunc {
+	if cfg == nil {
+		return func(string, string, []string) bool { return true }
+	}
+
+	return func(method string, route string, tags []string) bool {
+		target := fmt.Sprintf("%s %s", strings.ToUpper(method), route)
+		for _, pattern := range cfg.Exclude {
+			if matchesRule(pattern, target, tags) {
+				return false
+			}
+		}
+		if len(cfg.Include) == 0 {
+			return true
+		}
+		for _, pattern := range cfg.Include {
+			if matchesRule(pattern, target, tags) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchesRule checks a single include/exclude rule against a "METHOD /path" target and its tags.
+// Rules of the form "tag:beta" match against tags; everything else is matched against target,
+// with "*" standing in for a single path segment and "**" for any number of them.
+func matchesRule(pattern string, target string, tags []string) bool {
+	if strings.HasPrefix(pattern, "tag:") {
+		tagPattern := strings.TrimPrefix(pattern, "tag:")
+		for _, tag := range tags {
+			if globMatch(tagPattern, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return globMatch(pattern, target)
+}
+
+// globMatch reports whether value matches pattern, where "*" matches a single path segment
+// and "**" matches any number of segments.
+func globMatch(pattern string, value string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\*`, "[^/]*")
+	matched, _ := regexp.MatchString("^"+expr+"$", value)
+	return matched
+}
+
+// parseFileHeader reads the `openapi: METHOD /path` line and an optional `tags:` list out of a
+// scraped file's frontmatter, so callers don't need to parse it by hand.
+func parseFileHeader(content []byte) (method string, route string, tags []string, err error) {
+	lines := strings.Split(string(content), "\n")
+
+	var header []string
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			break
+		}
+		header = append(header, lines[i])
+	}
+
+	for i := 0; i < len(header); i++ {
+		line := header[i]
+		switch {
+		case strings.HasPrefix(line, "openapi: "):
+			spl := strings.SplitN(strings.TrimPrefix(line, "openapi: "), " ", 2)
+			if len(spl) != 2 {
+				return "", "", nil, fmt.Errorf("unexpected route name format: %s", line)
+			}
+			method, route = spl[0], spl[1]
+		case strings.HasPrefix(line, "tags: ["):
+			inline := strings.TrimSuffix(strings.TrimPrefix(line, "tags: ["), "]")
+			for _, tag := range strings.Split(inline, ",") {
+				if tag = strings.Trim(strings.TrimSpace(tag), `"'`); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		case strings.TrimSpace(line) == "tags:":
+			for i+1 < len(header) && strings.HasPrefix(strings.TrimSpace(header[i+1]), "-") {
+				i++
+				tag := strings.TrimPrefix(strings.TrimSpace(header[i]), "-")
+				if tag = strings.Trim(strings.TrimSpace(tag), `"'`); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+
+	return method, route, tags, nil
+}
+
+func clean(fsys fileSystem, tmpDir string) {
+	_ = fsys.RemoveAll(fmt.Sprintf("%s/", tmpDir))
 	return
 }
 
-func getAllFilesInDir(dir string) ([]string, error) {
+func getAllFilesInDir(fsys fileSystem, dir string) ([]string, error) {
 	var files []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
+		if !d.IsDir() {
 			files = append(files, path)
 		}
 		return nil
@@ -165,125 +515,296 @@ func getAllFilesInDir(dir string) ([]string, error) {
 	return files, nil
 }
 
-// rename renames the files in the tmp directory to the names that the user specifies.
+// nameEntry is a manifest record for a single route, persisted to namesManifestPath so the
+// sidebar name and target directory only need to be chosen once.
+type nameEntry struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+// missingRouteNamesError is returned by rename in CI mode when one or more routes have no
+// entry in the names manifest and therefore cannot be renamed without a human.
+type missingRouteNamesError struct {
+	Routes []string
+}
+
+func (e *missingRouteNamesError) Error() string {
+	return fmt.Sprintf("missing %s entries for the following route(s):\n  %s", namesManifestPath, strings.Join(e.Routes, "\n  "))
+}
+
+// loadNamesManifest reads the names manifest from path, returning an empty manifest if no such
+// file exists yet.
+func loadNamesManifest(path string) (map[string]nameEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]nameEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	manifest := map[string]nameEntry{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// writeNamesManifest persists the names manifest to path so it becomes a reviewable source of
+// truth that can be checked into git.
+func writeNamesManifest(path string, manifest map[string]nameEntry) error {
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+	out = append(out, '\n')
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+// defaultRouteName computes the suggested sidebar name and target directory for a route, derived
+// from its HTTP method and path: GET collections become plural "List X", GET-by-id and `/batch/`
+// routes become "Get X" and "Batch Get X", and writes become "Create"/"Update"/"Delete X".
+func defaultRouteName(method string, routePath string, targetDir string) (name string, targetDirectory string, err error) {
+	isPlural := false
+	var sb strings.Builder
+	switch method {
+	case "get":
+		if strings.Contains(routePath, "{") {
+			sb.WriteString("Get ")
+		} else if strings.Contains(routePath, "/batch/") {
+			isPlural = true
+			sb.WriteString("Batch Get ")
+		} else {
+			isPlural = true
+			sb.WriteString("List ")
+		}
+	case "post":
+		sb.WriteString("Create ")
+	case "put", "patch":
+		sb.WriteString("Update ")
+	case "delete":
+		sb.WriteString("Delete ")
+	}
+
+	pathSpl := strings.Split(routePath, "/")
+	if len(pathSpl) < 3 {
+		return "", "", fmt.Errorf("unexpected route name format: %s %s", method, routePath)
+	}
+
+	// Always assume a structure like ["", "api", "..."]
+	resource := pathSpl[2]
+	targetDirectory = fmt.Sprintf("%s/%s/", targetDir, strings.Join(pathSpl[2:len(pathSpl)], "/"))
+	targetDirectory = strings.ReplaceAll(targetDirectory, "_", "-")
+
+	resource = strings.ReplaceAll(resource, "-", " ")
+	resource = strings.ReplaceAll(resource, "_", " ")
+	resource = strings.Title(resource)
+	if !isPlural {
+		resource = strings.TrimSuffix(resource, "s")
+	}
+	sb.WriteString(resource)
+
+	return sb.String(), targetDirectory, nil
+}
+
+// rename renames the files in the tmp directory to the sidebar names recorded in manifest.
 // This affects how the API endpoints are displayed in the API reference sidebar.
-func rename(tmpDir string, targetDir string, files []string) (newfiles []string, err error) {
+//
+// When a route has no manifest entry, rename prompts for one on stdin, unless ciMode is set,
+// in which case the route is added to the returned missingRouteNamesError instead. Any newly
+// chosen names are added to manifest and manifestChanged is set so the caller can persist it.
+func rename(fsys fileSystem, tmpDir string, targetDir string, files []string, manifest map[string]nameEntry, ciMode bool) (newfiles []string, manifestChanged bool, err error) {
 	reader := bufio.NewReader(os.Stdin)
+	var missingRoutes []string
 
 	for _, oldPath := range files {
-		file, err := os.Open(oldPath)
+		content, err := fsys.ReadFile(oldPath)
 		if err != nil {
-			return nil, err
+			return nil, manifestChanged, err
 		}
 
-		scanner := bufio.NewScanner(file)
-		scanner.Scan() // read and discard the first line
-		scanner.Scan() // read the second line
-		route := strings.TrimPrefix(scanner.Text(), "openapi: ")
-		err = file.Close()
+		method, routePath, _, err := parseFileHeader(content)
 		if err != nil {
-			return nil, err
-		}
-
-		spl := strings.SplitN(route, " ", 2)
-		if len(spl) < 2 {
-			return nil, fmt.Errorf("unexpected route name format: %s", route)
-		}
-
-		isPlural := false
-		var sb strings.Builder
-		switch spl[0] {
-		case "get":
-			if strings.Contains(spl[1], "{") {
-				sb.WriteString("Get ")
-			} else if strings.Contains(spl[1], "/batch/") {
-				isPlural = true
-				sb.WriteString("Batch Get ")
-			} else {
-				isPlural = true
-				sb.WriteString("List ")
-			}
-		case "post":
-			sb.WriteString("Create ")
-		case "put", "patch":
-			sb.WriteString("Update ")
-		case "delete":
-			sb.WriteString("Delete ")
+			return nil, manifestChanged, err
 		}
+		route := fmt.Sprintf("%s %s", method, routePath)
 
-		pathSpl := strings.Split(spl[1], "/")
-		if len(pathSpl) < 3 {
-			return nil, fmt.Errorf("unexpected route name format: %s", route)
+		defaultName, targetDirectory, err := defaultRouteName(method, routePath, targetDir)
+		if err != nil {
+			return nil, manifestChanged, err
 		}
 
-		// Always assume a structure like ["", "api", "..."]
-		resource := pathSpl[2]
-		targetDirectory := fmt.Sprintf("%s/%s/", targetDir, strings.Join(pathSpl[2:len(pathSpl)], "/"))
-		targetDirectory = strings.ReplaceAll(targetDirectory, "_", "-")
-
-		resource = strings.ReplaceAll(resource, "-", " ")
-		resource = strings.ReplaceAll(resource, "_", " ")
-		resource = strings.Title(resource)
-		if !isPlural {
-			resource = strings.TrimSuffix(resource, "s")
+		entry, known := manifest[route]
+		var newName string
+		switch {
+		case known:
+			newName = entry.Name
+			if entry.Dir != "" {
+				targetDirectory = entry.Dir
+			}
+		case ciMode:
+			missingRoutes = append(missingRoutes, route)
+			continue
+		default:
+			fmt.Printf("Route: \"%s\" (default: \"%s\") => ", route, defaultName)
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, manifestChanged, err
+			}
+			newName = strings.TrimSpace(input)
+			if newName == "" {
+				newName = defaultName
+			}
 		}
-		sb.WriteString(resource)
 
-		defaultName := sb.String()
+		fileName := strings.ToLower(strings.ReplaceAll(newName, " ", "-"))
+		fileName = fmt.Sprintf("%s.mdx", fileName)
+		newPath := filepath.Join(filepath.Dir(targetDirectory), fileName)
 
-		fmt.Printf("Route: \"%s\" (default: \"%s\") => ", route, defaultName)
-		newName, err := reader.ReadString('\n')
-		if err != nil {
-			return nil, err
+		if !known {
+			manifest[route] = nameEntry{Name: newName, Dir: targetDirectory}
+			manifestChanged = true
 		}
-		newName = strings.TrimSpace(newName)
 
-		if newName == "" {
-			newName = defaultName
+		if err := fsys.MkdirAll(targetDirectory, 0755); err != nil {
+			return nil, manifestChanged, err
 		}
-
-		newName = strings.ReplaceAll(newName, " ", "-")
-		newName = strings.ToLower(newName)
-		newName = fmt.Sprintf("%s.mdx", newName)
-		newPath := filepath.Join(filepath.Dir(targetDirectory), newName)
-
-		if _, err := os.Stat(targetDirectory); os.IsNotExist(err) {
-			err = os.MkdirAll(targetDirectory, 0755)
-			if err != nil {
-				return nil, err
-			}
-		}
-		err = os.Rename(oldPath, newPath)
+		err = fsys.Rename(oldPath, newPath)
 		if err != nil {
-			return nil, err
+			return nil, manifestChanged, err
 		}
 		newfiles = append(newfiles, newPath)
 	}
 
-	return newfiles, nil
+	if len(missingRoutes) > 0 {
+		sort.Strings(missingRoutes)
+		return newfiles, manifestChanged, &missingRouteNamesError{Routes: missingRoutes}
+	}
+
+	return newfiles, manifestChanged, nil
+}
+
+// similarityThreshold is the minimum normalized-line Jaccard score two files must share to be
+// considered the same endpoint when no route key match is available.
+const similarityThreshold = 0.8
+
+// targetFile is a single file already present in targetDir, indexed for matching against
+// newly scraped files.
+type targetFile struct {
+	path    string
+	route   string
+	content []byte
 }
 
-// findMatchingFile checks if a file with the same content as the given content exists in the given directory or its child directories.
-// Returns the path of the file that was found to match, or an empty string if it does not exist.
-func findMatchingFile(dir string, content []byte) (res string, err error) {
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// indexTargetFiles walks dir and builds a targetFile for every file in it, keying each one by
+// its `openapi: METHOD /path` line so match can link scraped files to existing ones by route
+// identity before falling back to content similarity.
+func indexTargetFiles(fsys fileSystem, dir string) ([]targetFile, error) {
+	var targets []targetFile
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			fileContent, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			if string(fileContent) == string(content) {
-				res = path
-				return nil
-			}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			return err
 		}
+		var route string
+		if method, routePath, _, err := parseFileHeader(content); err == nil && method != "" {
+			route = fmt.Sprintf("%s %s", method, routePath)
+		}
+		targets = append(targets, targetFile{path: path, route: route, content: content})
 		return nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return targets, nil
+}
+
+// routeMatchScore is the score assigned to a scraped/target pair that share a route key. It
+// outranks every possible Jaccard similarity score (which tops out at 1), so an exact route
+// match always wins a fuzzy one when both are on the table for the same pair.
+const routeMatchScore = 2.0
+
+// candidateMatch is one plausible pairing between a scraped file and a target file, along with
+// the confidence score assignMatches uses to decide which pairings to keep.
+type candidateMatch struct {
+	scrapedPath string
+	targetPath  string
+	score       float64
+}
+
+// assignMatches decides which scraped file, if any, corresponds to each target file. It scores
+// every scraped/target pair - routeMatchScore for a shared route key, otherwise their
+// normalized-line Jaccard similarity if it clears similarityThreshold - then assigns pairs
+// greedily from highest score to lowest, skipping any pair whose scraped file or target file has
+// already been claimed. This ensures two unrelated scraped files can never both be assigned the
+// same target, even if both independently clear the similarity threshold against it.
+func assignMatches(scraped []scrapedFile, targets []targetFile) map[string]string {
+	var candidates []candidateMatch
+	for _, s := range scraped {
+		for _, t := range targets {
+			if s.routeKey != "" && s.routeKey == t.route {
+				candidates = append(candidates, candidateMatch{scrapedPath: s.path, targetPath: t.path, score: routeMatchScore})
+				continue
+			}
+			if score := lineJaccard(s.content, t.content); score >= similarityThreshold {
+				candidates = append(candidates, candidateMatch{scrapedPath: s.path, targetPath: t.path, score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	assignments := map[string]string{}
+	claimedScraped := map[string]bool{}
+	claimedTargets := map[string]bool{}
+	for _, c := range candidates {
+		if claimedScraped[c.scrapedPath] || claimedTargets[c.targetPath] {
+			continue
+		}
+		assignments[c.scrapedPath] = c.targetPath
+		claimedScraped[c.scrapedPath] = true
+		claimedTargets[c.targetPath] = true
+	}
+	return assignments
+}
+
+// lineJaccard returns the Jaccard similarity between the trimmed, non-empty lines of a and b.
+func lineJaccard(a []byte, b []byte) float64 {
+	setA := lineSet(a)
+	setB := lineSet(b)
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for line := range setA {
+		if setB[line] {
+			intersection++
+		}
+	}
+	union := len(setA) + len(setB) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+// lineSet splits content into a set of its trimmed, non-empty lines.
+func lineSet(content []byte) map[string]bool {
+	set := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			set[line] = true
+		}
 	}
-	return res, nil
+	return set
 }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// mapFS is an in-memory fileSystem for tests, in the spirit of golang.org/x/tools/godoc/vfs/mapfs.
+type mapFS struct {
+	fstest.MapFS
+}
+
+func newMapFS(files map[string]string) *mapFS {
+	m := fstest.MapFS{}
+	for name, content := range files {
+		m[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+	}
+	return &mapFS{MapFS: m}
+}
+
+func (m *mapFS) ReadFile(name string) ([]byte, error) {
+	f, ok := m.MapFS[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.Data, nil
+}
+
+func (m *mapFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (m *mapFS) Remove(name string) error {
+	if _, ok := m.MapFS[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.MapFS, name)
+	return nil
+}
+
+func (m *mapFS) RemoveAll(path string) error {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for name := range m.MapFS {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(m.MapFS, name)
+		}
+	}
+	return nil
+}
+
+func (m *mapFS) Rename(oldpath string, newpath string) error {
+	f, ok := m.MapFS[oldpath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	m.MapFS[newpath] = f
+	delete(m.MapFS, oldpath)
+	return nil
+}
+
+func (m *mapFS) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func endpointFile(method string, route string, body string) string {
+	return "---\nopenapi: " + method + " " + route + "\n---\n" + body
+}
+
+func TestMatch_NewEndpointDetection(t *testing.T) {
+	fsys := newMapFS(map[string]string{
+		"tmp/orders.mdx":                     endpointFile("get", "/api/orders/{id}", "order"),
+		"reference/api/orders/get-order.mdx": endpointFile("get", "/api/orders/{id}", "order"),
+		"tmp/invoices.mdx":                   endpointFile("get", "/api/invoices/{id}", "invoice"),
+	})
+
+	existing, newFiles, err := match(fsys, "tmp", "reference/api", buildSelectFunc(nil))
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+
+	if len(existing) != 1 || existing[0] != "reference/api/orders/get-order.mdx" {
+		t.Fatalf("expected orders file to be matched as existing, got %v", existing)
+	}
+	if len(newFiles) != 1 || newFiles[0] != "tmp/invoices.mdx" {
+		t.Fatalf("expected invoices file to be treated as new, got %v", newFiles)
+	}
+}
+
+func TestMatch_SelectFuncExcludesEndpoint(t *testing.T) {
+	fsys := newMapFS(map[string]string{
+		"tmp/internal.mdx":               endpointFile("get", "/api/internal/{id}", "internal"),
+		"reference/api/introduction.mdx": "intro",
+	})
+	cfg := &docsgenConfig{Exclude: []string{"GET /api/internal/*"}}
+
+	existing, newFiles, err := match(fsys, "tmp", "reference/api", buildSelectFunc(cfg))
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if len(existing) != 0 || len(newFiles) != 0 {
+		t.Fatalf("expected excluded endpoint to be dropped, got existing=%v newFiles=%v", existing, newFiles)
+	}
+	if _, err := fsys.ReadFile("tmp/internal.mdx"); err == nil {
+		t.Fatalf("expected excluded scraped file to be removed from tmp")
+	}
+}
+
+func TestMatch_CollidingFuzzyMatchesClaimOnlyOneTarget(t *testing.T) {
+	boilerplate := "## Headers\n\n| Name | Type |\n|------|------|\n| Authorization | string |\n\n## Response\n\n| Field | Type |\n|-------|------|\n| id | string |\n| status | string |\n"
+
+	fsys := newMapFS(map[string]string{
+		"tmp/alpha.mdx":                      endpointFile("get", "/api/entity-alpha/{id}", boilerplate),
+		"tmp/beta.mdx":                       endpointFile("get", "/api/entity-beta/{id}", boilerplate),
+		"reference/api/orders/get-order.mdx": endpointFile("get", "/api/orders/{id}", boilerplate),
+	})
+
+	existing, newFiles, err := match(fsys, "tmp", "reference/api", buildSelectFunc(nil))
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+
+	if len(existing) != 1 || existing[0] != "reference/api/orders/get-order.mdx" {
+		t.Fatalf("expected exactly one of alpha/beta to claim get-order.mdx, got existing=%v", existing)
+	}
+	if len(newFiles) != 1 {
+		t.Fatalf("expected the losing candidate to be treated as a new file, got %v", newFiles)
+	}
+
+	content, err := fsys.ReadFile("reference/api/orders/get-order.mdx")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	method, route, _, err := parseFileHeader(content)
+	if err != nil {
+		t.Fatalf("parseFileHeader: %v", err)
+	}
+	winner := fmt.Sprintf("%s %s", method, route)
+	if winner != "get /api/entity-alpha/{id}" && winner != "get /api/entity-beta/{id}" {
+		t.Fatalf("expected get-order.mdx to contain alpha's or beta's content, got %q", winner)
+	}
+
+	loserPath := newFiles[0]
+	loserContent, err := fsys.ReadFile(loserPath)
+	if err != nil {
+		t.Fatalf("ReadFile(%s): %v", loserPath, err)
+	}
+	loserMethod, loserRoute, _, err := parseFileHeader(loserContent)
+	if err != nil {
+		t.Fatalf("parseFileHeader: %v", err)
+	}
+	loser := fmt.Sprintf("%s %s", loserMethod, loserRoute)
+	if loser == winner {
+		t.Fatalf("expected the new file to be the losing candidate, not a duplicate of the winner")
+	}
+	if loser != "get /api/entity-alpha/{id}" && loser != "get /api/entity-beta/{id}" {
+		t.Fatalf("unexpected new file route %q", loser)
+	}
+}
+
+func TestFilesToRemove_IgnoreList(t *testing.T) {
+	oldFiles := []string{
+		"reference/api/introduction.mdx",
+		"reference/api/orders/get-order.mdx",
+		"reference/api/invoices/get-invoice.mdx",
+	}
+	existingFiles := []string{"reference/api/orders/get-order.mdx"}
+	ignore := map[string]bool{"reference/api/introduction.mdx": true}
+
+	got := filesToRemove(oldFiles, existingFiles, ignore)
+	want := []string{"reference/api/invoices/get-invoice.mdx"}
+	if !equalStrings(got, want) {
+		t.Fatalf("filesToRemove() = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateMintNavigation_PreservesGroupFieldsAndUntouchedOrder(t *testing.T) {
+	mintPath := filepath.Join(t.TempDir(), "mint.json")
+	initial := map[string]interface{}{
+		"navigation": []interface{}{
+			map[string]interface{}{
+				"group": "Orders",
+				"icon":  "box",
+				"pages": []interface{}{
+					"reference/api/orders/list-orders",
+					"reference/api/orders/get-order",
+					"reference/api/orders/create-order",
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(initial)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if err := ioutil.WriteFile(mintPath, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := updateMintNavigation(mintPath, "reference/api", []string{"reference/api/widgets/list-widgets.mdx"}); err != nil {
+		t.Fatalf("updateMintNavigation: %v", err)
+	}
+
+	out, err := ioutil.ReadFile(mintPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	navigation, _ := config["navigation"].([]interface{})
+	if len(navigation) != 2 {
+		t.Fatalf("expected 2 groups, got %d: %v", len(navigation), navigation)
+	}
+
+	orders, _ := navigation[0].(map[string]interface{})
+	if orders["icon"] != "box" {
+		t.Fatalf("expected Orders group to keep its icon field, got %v", orders["icon"])
+	}
+	orderedPages := groupPages(orders["pages"])
+	want := []string{
+		"reference/api/orders/list-orders",
+		"reference/api/orders/get-order",
+		"reference/api/orders/create-order",
+	}
+	for i, p := range want {
+		if orderedPages[i] != p {
+			t.Fatalf("expected Orders pages to stay in their original order, got %v", orderedPages)
+		}
+	}
+
+	widgets, _ := navigation[1].(map[string]interface{})
+	if widgets["group"] != "Widgets" {
+		t.Fatalf("expected new Widgets group, got %v", navigation[1])
+	}
+}
+
+func TestDefaultRouteName(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		route    string
+		wantName string
+		wantDir  string
+	}{
+		{"get collection is plural List", "get", "/api/orders", "List Orders", "reference/api/orders/"},
+		{"get by id is singular Get", "get", "/api/orders/{id}", "Get Order", "reference/api/orders/{id}/"},
+		{"batch get is plural Batch Get", "get", "/api/orders/batch/get", "Batch Get Orders", "reference/api/orders/batch/get/"},
+		{"post is singular Create", "post", "/api/orders", "Create Order", "reference/api/orders/"},
+		{"delete by id is singular Delete", "delete", "/api/orders/{id}", "Delete Order", "reference/api/orders/{id}/"},
+		{"unusual path depth keeps top-level resource", "get", "/api/orders/{id}/items/{itemId}", "Get Order", "reference/api/orders/{id}/items/{itemId}/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, dir, err := defaultRouteName(tt.method, tt.route, "reference/api")
+			if err != nil {
+				t.Fatalf("defaultRouteName: %v", err)
+			}
+			if name != tt.wantName {
+				t.Fatalf("name = %q, want %q", name, tt.wantName)
+			}
+			if dir != tt.wantDir {
+				t.Fatalf("targetDirectory = %q, want %q", dir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestDefaultRouteName_UnexpectedFormat(t *testing.T) {
+	if _, _, err := defaultRouteName("get", "/short", "reference/api"); err == nil {
+		t.Fatalf("expected an error for a route with too few path segments")
+	}
+}
+
+func TestRename_UsesManifestEntry(t *testing.T) {
+	fsys := newMapFS(map[string]string{
+		"tmp/scraped.mdx": endpointFile("get", "/api/orders/{id}", "body"),
+	})
+	manifest := map[string]nameEntry{
+		"get /api/orders/{id}": {Name: "Fetch Order", Dir: "reference/api/orders/"},
+	}
+
+	renamed, changed, err := rename(fsys, "tmp", "reference/api", []string{"tmp/scraped.mdx"}, manifest, false)
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if changed {
+		t.Fatalf("expected manifest to be left unchanged when an entry already exists")
+	}
+	want := "reference/api/orders/fetch-order.mdx"
+	if len(renamed) != 1 || renamed[0] != want {
+		t.Fatalf("renamed = %v, want [%s]", renamed, want)
+	}
+	if _, err := fsys.ReadFile(want); err != nil {
+		t.Fatalf("expected %s to exist after rename: %v", want, err)
+	}
+}
+
+func TestRename_CIModeReportsMissingNames(t *testing.T) {
+	fsys := newMapFS(map[string]string{
+		"tmp/scraped.mdx": endpointFile("get", "/api/orders/{id}", "body"),
+	})
+
+	_, _, err := rename(fsys, "tmp", "reference/api", []string{"tmp/scraped.mdx"}, map[string]nameEntry{}, true)
+	var missingErr *missingRouteNamesError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("expected a missingRouteNamesError, got %v", err)
+	}
+	if len(missingErr.Routes) != 1 || missingErr.Routes[0] != "get /api/orders/{id}" {
+		t.Fatalf("unexpected missing routes: %v", missingErr.Routes)
+	}
+}
+
+func TestRun_CleansTmpEvenWhenMissingNamesExitsNonZero(t *testing.T) {
+	fsys := newMapFS(map[string]string{
+		"tmp/scraped.mdx":                endpointFile("get", "/api/orders/{id}", "body"),
+		"reference/api/introduction.mdx": "intro",
+	})
+
+	prevCI := *ciMode
+	*ciMode = true
+	defer func() { *ciMode = prevCI }()
+
+	code := run(fsys)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	if _, err := fs.Stat(fsys, "tmp/scraped.mdx"); err == nil {
+		t.Fatalf("expected tmp to be cleaned up even though run exited with a missing-names error")
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}